@@ -0,0 +1,31 @@
+package gps
+
+// SourceManagerConfig holds the options used to construct a SourceManager
+// (and, transitively, its sourceCoordinator and sourceGateways).
+type SourceManagerConfig struct {
+	// Cachedir is the base directory in which the SourceManager should
+	// create its per-source working directories and any cache files.
+	Cachedir string
+
+	// DisableCache turns off the persistent, BoltDB-backed singleSourceCache
+	// implementation, falling back to a purely in-memory cache that does
+	// not survive process restarts. Leaving this false lets gps reuse
+	// project metadata, package trees, and version lists across runs
+	// instead of re-fetching them from upstream on every cold start.
+	DisableCache bool
+
+	// MaxConcurrentVCS bounds how many expensive, network- or disk-bound
+	// source calls (HTTP metadata lookups, VCS clones/fetches) may run at
+	// once across the whole SourceManager. Zero means unbounded. Without a
+	// limit, a wide dependency graph can fan out into enough simultaneous
+	// clones to thrash disk I/O or trip an SCM's rate limiting.
+	MaxConcurrentVCS int
+
+	// PreferLocal tells sources to trust whatever they already have on
+	// disk (or in the cache) over checking upstream, skipping network
+	// round-trips whenever locally-available data would do. It's meant
+	// for re-solving in CI or air-gapped environments where the working
+	// copies are already known-good; sources still fall back to upstream
+	// if the local data is genuinely missing.
+	PreferLocal bool
+}
@@ -0,0 +1,207 @@
+package gps
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// pathDeduction is the result of reducing an import path down to the source
+// (repository) that contains it.
+//
+// root is the deduced repository root - the prefix of the import path that
+// maps onto a single source. postfix is whatever remained of the import
+// path after root was stripped off, e.g. deducing
+// "github.com/foo/bar/subpkg" yields root "github.com/foo/bar" and postfix
+// "subpkg"; postfix is empty when the import path names the repository
+// root exactly.
+type pathDeduction struct {
+	root    string
+	postfix string
+	mb      maybeSource
+}
+
+// deductionCoordinator deduces repository roots (and sub-package postfixes)
+// for import paths, memoizing results so that the underlying per-host
+// deduction logic - which may involve network calls to resolve vanity
+// import paths - only runs once per distinct path.
+type deductionCoordinator struct {
+	callMgr *callManager
+	mu      sync.RWMutex
+	cache   map[string]pathDeduction
+}
+
+func newDeductionCoordinator(cm *callManager) *deductionCoordinator {
+	return &deductionCoordinator{
+		callMgr: cm,
+		cache:   make(map[string]pathDeduction),
+	}
+}
+
+// rootPostfixHosts lists the well-known hosting services whose repository
+// roots are always exactly two path segments below the host - e.g.
+// github.com/user/repo - so anything deeper in an import path on one of
+// these hosts is a sub-package postfix rather than part of the root.
+var rootPostfixHosts = map[string]bool{
+	"github.com":    true,
+	"bitbucket.org": true,
+	"launchpad.net": true,
+}
+
+// deduceRootPath splits path into a repository root and, for hosts in
+// rootPostfixHosts, the sub-package postfix (if any) beneath that root.
+// Results are memoized on the unmodified input path, same as before
+// sub-package postfixes were supported.
+func (dc *deductionCoordinator) deduceRootPath(ctx context.Context, path string) (pathDeduction, error) {
+	dc.mu.RLock()
+	pd, has := dc.cache[path]
+	dc.mu.RUnlock()
+	if has {
+		return pd, nil
+	}
+
+	root, postfix := splitRootPostfix(path)
+
+	mb, err := dc.deduceSource(ctx, root)
+	if err != nil {
+		// As elsewhere in this package, don't cache errors so that
+		// externally-driven retry strategies can be constructed.
+		return pathDeduction{}, err
+	}
+
+	pd = pathDeduction{root: root, postfix: postfix, mb: mb}
+
+	dc.mu.Lock()
+	dc.cache[path] = pd
+	dc.mu.Unlock()
+
+	return pd, nil
+}
+
+// splitRootPostfix splits an import path into its repository root and any
+// sub-package postfix beneath it, for the well-known hosts in
+// rootPostfixHosts. Paths on other hosts are assumed to name their
+// repository root exactly, with no postfix - the same behavior this
+// package had before sub-package postfixes were supported.
+func splitRootPostfix(path string) (root, postfix string) {
+	segs := strings.Split(path, "/")
+	if len(segs) == 0 || !rootPostfixHosts[segs[0]] || len(segs) <= 3 {
+		return path, ""
+	}
+
+	return strings.Join(segs[:3], "/"), strings.Join(segs[3:], "/")
+}
+
+// knownHosts maps a well-known hosting service to the VCS it always serves
+// repositories over, letting paths under it resolve without a network round
+// trip to discover go-import metadata.
+var knownHosts = map[string]string{
+	"github.com":    "git",
+	"bitbucket.org": "git",
+	"launchpad.net": "bzr",
+}
+
+// maybeSource is a deduced, not-yet-verified candidate for producing a
+// source for a repository root; try() confirms it (locating or cloning the
+// repo as needed) and hands back the working source.
+type maybeSource interface {
+	try(ctx context.Context, cachedir string, cache singleSourceCache) (source, string, error)
+}
+
+// vcsMaybeSource is a maybeSource whose VCS kind and canonical repository
+// URL have already been deduced (either from knownHosts or a go-import
+// vanity import tag). Standing up an actual source backend per VCS - git,
+// bzr, etc. clone/fetch/checkout mechanics - is a separate, much larger
+// concern than deduction itself and isn't implemented by this package yet;
+// try() fails with a specific, named error identifying exactly what's
+// missing, rather than deduction itself failing for every input the way an
+// unconfigured hook would.
+type vcsMaybeSource struct {
+	vcs string
+	url string
+}
+
+func (mb vcsMaybeSource) try(ctx context.Context, cachedir string, cache singleSourceCache) (source, string, error) {
+	return nil, "", fmt.Errorf("gps: no %s source backend is registered to handle %q", mb.vcs, mb.url)
+}
+
+// deduceSource resolves root to a maybeSource, detecting the VCS in play
+// via the knownHosts table, falling back to the go-get vanity import
+// protocol (an HTTP GET of "https://root?go-get=1", looking for a
+// "go-import" meta tag) for anything else.
+func (dc *deductionCoordinator) deduceSource(ctx context.Context, root string) (maybeSource, error) {
+	if root == "" {
+		return nil, fmt.Errorf("cannot deduce a source for an empty path")
+	}
+
+	host := root
+	if i := strings.IndexByte(root, '/'); i != -1 {
+		host = root[:i]
+	}
+
+	if vcs, has := knownHosts[host]; has {
+		return vcsMaybeSource{vcs: vcs, url: "https://" + root}, nil
+	}
+
+	return dc.deduceVanitySource(ctx, root)
+}
+
+// goImportMetaRE matches a go-import HTML meta tag, per
+// https://pkg.go.dev/cmd/go#hdr-Remote_import_paths. It accepts single or
+// double quotes and an optional self-closing slash, but expects the name
+// attribute before content and no other attributes in between; it is not a
+// full HTML parser.
+var goImportMetaRE = regexp.MustCompile(`<meta\s+name=["']go-import["']\s+content=["']([^"']+)["']\s*/?>`)
+
+// deduceVanitySource resolves root via the go-get vanity import protocol,
+// fetching "https://root?go-get=1" and reading the go-import meta tag out
+// of the response body. The HTTP call is routed through callMgr so it's
+// subject to the same concurrency limits and observability as any other
+// throttled call (see CallTypeHTTPMetadata).
+func (dc *deductionCoordinator) deduceVanitySource(ctx context.Context, root string) (maybeSource, error) {
+	cctx, done, err := dc.callMgr.setUpCall(ctx, root, CallTypeHTTPMetadata)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	req, err := http.NewRequest("GET", "https://"+root+"?go-get=1", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(cctx))
+	if err != nil {
+		return nil, fmt.Errorf("could not deduce repository root for %q: %s", root, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read go-import metadata for %q: %s", root, err)
+	}
+
+	return parseGoImportMeta(body, root)
+}
+
+// parseGoImportMeta extracts a maybeSource from the go-import meta tag in
+// body, the HTML returned for root's "?go-get=1" request. Split out from
+// deduceVanitySource so the parsing logic can be tested without a network
+// round trip.
+func parseGoImportMeta(body []byte, root string) (maybeSource, error) {
+	m := goImportMetaRE.FindSubmatch(body)
+	if m == nil {
+		return nil, fmt.Errorf("%q is neither a recognized hosting service nor a go-import vanity path", root)
+	}
+
+	fields := strings.Fields(string(m[1]))
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("malformed go-import meta tag for %q: %q", root, m[1])
+	}
+
+	return vcsMaybeSource{vcs: fields[1], url: fields[2]}, nil
+}
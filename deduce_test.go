@@ -0,0 +1,135 @@
+package gps
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSplitRootPostfix(t *testing.T) {
+	cases := []struct {
+		path, root, postfix string
+	}{
+		{"github.com/foo/bar", "github.com/foo/bar", ""},
+		{"github.com/foo/bar/subpkg", "github.com/foo/bar", "subpkg"},
+		{"github.com/foo/bar/sub/pkg", "github.com/foo/bar", "sub/pkg"},
+		{"bitbucket.org/foo/bar/subpkg", "bitbucket.org/foo/bar", "subpkg"},
+		{"launchpad.net/foo/bar/subpkg", "launchpad.net/foo/bar", "subpkg"},
+		// Unknown hosts are assumed to name their repo root exactly.
+		{"example.com/foo/bar/subpkg", "example.com/foo/bar/subpkg", ""},
+		{"example.com/foo", "example.com/foo", ""},
+	}
+
+	for _, c := range cases {
+		root, postfix := splitRootPostfix(c.path)
+		if root != c.root || postfix != c.postfix {
+			t.Errorf("splitRootPostfix(%q) = (%q, %q), want (%q, %q)", c.path, root, postfix, c.root, c.postfix)
+		}
+	}
+}
+
+func TestDeduceSourceKnownHosts(t *testing.T) {
+	dc := newDeductionCoordinator(newCallManager(context.Background(), 0))
+
+	mb, err := dc.deduceSource(context.Background(), "github.com/foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	vmb, ok := mb.(vcsMaybeSource)
+	if !ok {
+		t.Fatalf("expected vcsMaybeSource, got %T", mb)
+	}
+	if vmb.vcs != "git" {
+		t.Errorf("vcs = %q, want %q", vmb.vcs, "git")
+	}
+	if vmb.url != "https://github.com/foo/bar" {
+		t.Errorf("url = %q, want %q", vmb.url, "https://github.com/foo/bar")
+	}
+}
+
+func TestDeduceSourceEmptyRoot(t *testing.T) {
+	dc := newDeductionCoordinator(newCallManager(context.Background(), 0))
+
+	if _, err := dc.deduceSource(context.Background(), ""); err == nil {
+		t.Error("expected an error deducing an empty root, got nil")
+	}
+}
+
+func TestParseGoImportMeta(t *testing.T) {
+	cases := []struct {
+		name    string
+		body    string
+		wantErr bool
+		vcs     string
+		url     string
+	}{
+		{
+			name: "well-formed",
+			body: `<html><head>
+				<meta name="go-import" content="example.org/pkg git https://github.com/someone/pkg">
+				</head></html>`,
+			vcs: "git",
+			url: "https://github.com/someone/pkg",
+		},
+		{
+			name:    "no meta tag",
+			body:    `<html><head></head></html>`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed content",
+			body:    `<meta name="go-import" content="example.org/pkg git">`,
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mb, err := parseGoImportMeta([]byte(c.body), "example.org/pkg")
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			vmb, ok := mb.(vcsMaybeSource)
+			if !ok {
+				t.Fatalf("expected vcsMaybeSource, got %T", mb)
+			}
+			if vmb.vcs != c.vcs || vmb.url != c.url {
+				t.Errorf("got {vcs:%q url:%q}, want {vcs:%q url:%q}", vmb.vcs, vmb.url, c.vcs, c.url)
+			}
+		})
+	}
+}
+
+func TestDeduceRootPathMemoizes(t *testing.T) {
+	dc := newDeductionCoordinator(newCallManager(context.Background(), 0))
+
+	pd1, err := dc.deduceRootPath(context.Background(), "github.com/foo/bar/subpkg")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pd1.root != "github.com/foo/bar" || pd1.postfix != "subpkg" {
+		t.Fatalf("got root=%q postfix=%q, want root=%q postfix=%q", pd1.root, pd1.postfix, "github.com/foo/bar", "subpkg")
+	}
+
+	// A fresh deduction would produce a value equal to pd1, so plant a
+	// distinguishable entry in the memo to tell a cache hit from a recompute.
+	sentinel := pathDeduction{root: "memoized", postfix: "sentinel", mb: vcsMaybeSource{vcs: "memoized"}}
+	dc.mu.Lock()
+	dc.cache["github.com/foo/bar/subpkg"] = sentinel
+	dc.mu.Unlock()
+
+	pd2, err := dc.deduceRootPath(context.Background(), "github.com/foo/bar/subpkg")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pd2 != sentinel {
+		t.Error("second deduceRootPath call for the same path didn't return the memoized result")
+	}
+}
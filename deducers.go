@@ -3,6 +3,8 @@ package gps
 import (
 	"context"
 	"fmt"
+	"path"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,30 +27,116 @@ type callManager struct {
 	mu         sync.Mutex // Guards all maps.
 	running    map[callInfo]timeCount
 	//running map[callInfo]time.Time
-	ran map[callType]durCount
-	//ran map[callType]time.Duration
+	ran map[CallType]durCount
+	//ran map[CallType]time.Duration
+
+	// sem bounds how many throttled calls (see isThrottled) may be in
+	// flight at once. nil means unbounded.
+	sem chan struct{}
+
+	namemu    sync.Mutex // guards repoLocks
+	repoLocks map[string]chan struct{}
+
+	cbmu      sync.Mutex // guards callbacks
+	callbacks []func(CallEvent)
 }
 
-func newCallManager(ctx context.Context) *callManager {
+func newCallManager(ctx context.Context, maxConcurrentVCS int) *callManager {
 	ctx, cf := context.WithCancel(ctx)
-	return &callManager{
+	cm := &callManager{
 		ctx:        ctx,
 		cancelFunc: cf,
 		running:    make(map[callInfo]timeCount),
-		ran:        make(map[callType]durCount),
+		ran:        make(map[CallType]durCount),
+		repoLocks:  make(map[string]chan struct{}),
+	}
+
+	if maxConcurrentVCS > 0 {
+		cm.sem = make(chan struct{}, maxConcurrentVCS)
+	}
+
+	return cm
+}
+
+// isThrottled reports whether typ is an expensive, network- or disk-bound
+// operation that should be bounded by cm.sem and serialized per-repo via
+// repoLocks, rather than being allowed to fan out unbounded.
+func isThrottled(typ CallType) bool {
+	switch typ {
+	case CallTypeHTTPMetadata, CallTypeVCSFetch, CallTypeVCSClone:
+		return true
+	default:
+		return false
+	}
+}
+
+// acquireRepoLock serializes throttled calls that target the same repo
+// (callInfo.name), even when they arrive via different sourceGateways, so
+// two callers never clone/fetch the same repo concurrently. It respects ctx
+// cancellation while waiting.
+func (cm *callManager) acquireRepoLock(ctx context.Context, name string) (chan struct{}, error) {
+	cm.namemu.Lock()
+	lock, has := cm.repoLocks[name]
+	if !has {
+		lock = make(chan struct{}, 1)
+		cm.repoLocks[name] = lock
+	}
+	cm.namemu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		return lock, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
+func releaseRepoLock(lock chan struct{}) {
+	<-lock
+}
+
 // Helper function to register a call with a callManager, combine contexts, and
 // create a to-be-deferred func to clean it all up.
-func (cm *callManager) setUpCall(inctx context.Context, name string, typ callType) (cctx context.Context, doneFunc func(), err error) {
+func (cm *callManager) setUpCall(inctx context.Context, name string, typ CallType) (cctx context.Context, doneFunc func(), err error) {
 	ci := callInfo{
 		name: name,
 		typ:  typ,
 	}
 
+	throttled := isThrottled(typ)
+	var lock chan struct{}
+
+	if throttled {
+		if cm.sem != nil {
+			select {
+			case cm.sem <- struct{}{}:
+			case <-inctx.Done():
+				return nil, nil, inctx.Err()
+			}
+		}
+
+		lock, err = cm.acquireRepoLock(inctx, name)
+		if err != nil {
+			if cm.sem != nil {
+				<-cm.sem
+			}
+			return nil, nil, err
+		}
+	}
+
+	release := func() {
+		if !throttled {
+			return
+		}
+		releaseRepoLock(lock)
+		if cm.sem != nil {
+			<-cm.sem
+		}
+	}
+
 	octx, err := cm.run(ci)
 	if err != nil {
+		release()
 		return nil, nil, err
 	}
 
@@ -56,6 +144,7 @@ func (cm *callManager) setUpCall(inctx context.Context, name string, typ callTyp
 	return cctx, func() {
 		cm.done(ci)
 		cancelFunc() // ensure constext cancel goroutine is cleaned up
+		release()
 	}, nil
 }
 
@@ -65,9 +154,9 @@ func (cm *callManager) getLifetimeContext() context.Context {
 
 func (cm *callManager) run(ci callInfo) (context.Context, error) {
 	cm.mu.Lock()
-	defer cm.mu.Unlock()
 	if cm.ctx.Err() != nil {
 		// We've already been canceled; error out.
+		cm.mu.Unlock()
 		return nil, cm.ctx.Err()
 	}
 
@@ -80,6 +169,9 @@ func (cm *callManager) run(ci callInfo) (context.Context, error) {
 			start: time.Now(),
 		}
 	}
+	cm.mu.Unlock()
+
+	cm.fire(CallEvent{Name: ci.name, Type: ci.typ, Event: CallEventRun})
 
 	return cm.ctx, nil
 }
@@ -89,37 +181,132 @@ func (cm *callManager) done(ci callInfo) {
 
 	existingInfo, has := cm.running[ci]
 	if !has {
+		cm.mu.Unlock()
 		panic(fmt.Sprintf("sourceMgr: tried to complete a call that had not registered via run()"))
 	}
 
+	var dur time.Duration
 	if existingInfo.count > 1 {
 		// If more than one is pending, don't stop the clock yet.
 		existingInfo.count--
 		cm.running[ci] = existingInfo
 	} else {
 		// Last one for this particular key; update metrics with info.
+		dur = time.Now().Sub(existingInfo.start)
 		durCnt := cm.ran[ci.typ]
 		durCnt.count++
-		durCnt.dur += time.Now().Sub(existingInfo.start)
+		durCnt.dur += dur
 		cm.ran[ci.typ] = durCnt
 		delete(cm.running, ci)
 	}
 
 	cm.mu.Unlock()
+
+	cm.fire(CallEvent{Name: ci.name, Type: ci.typ, Event: CallEventDone, Duration: dur})
+}
+
+// CallEventType distinguishes the two points in a call's lifecycle that get
+// reported to RegisterCallback subscribers.
+type CallEventType uint8
+
+const (
+	CallEventRun CallEventType = iota
+	CallEventDone
+)
+
+// CallEvent describes a single call starting or finishing, for bridging
+// callManager activity into external metrics systems (Prometheus,
+// OpenTelemetry, etc. via RegisterCallback).
+type CallEvent struct {
+	Name  string
+	Type  CallType
+	Event CallEventType
+	// Duration is only meaningful on a CallEventDone event marking the
+	// last-concurrent-caller's completion; it's the total time the call was
+	// in flight.
+	Duration time.Duration
+}
+
+// RegisterCallback registers f to be called on every CallEventRun and
+// CallEventDone, letting embedders bridge gps's internal call accounting
+// into their own observability stack. f is called synchronously from
+// run()/done(), so it should not block or call back into the callManager.
+func (cm *callManager) RegisterCallback(f func(CallEvent)) {
+	cm.cbmu.Lock()
+	cm.callbacks = append(cm.callbacks, f)
+	cm.cbmu.Unlock()
+}
+
+func (cm *callManager) fire(ev CallEvent) {
+	cm.cbmu.Lock()
+	cbs := cm.callbacks
+	cm.cbmu.Unlock()
+
+	for _, f := range cbs {
+		f(ev)
+	}
+}
+
+// CallStats is a point-in-time summary of the calls of one CallType that a
+// callManager has observed.
+type CallStats struct {
+	// Count is how many calls of this type have completed. Calls that
+	// overlap in time with the same name and type are counted once, when
+	// the last of them finishes.
+	Count int
+	// Duration is the cumulative wall-clock time spent across all completed
+	// calls of this type; each group of overlapping same-name calls adds
+	// the span from its first start to its last finish.
+	Duration time.Duration
+	// InFlight is how many calls of this type are currently running.
+	InFlight int
+	// OldestInFlight is how long the longest-running in-flight call of this
+	// type has been running, or zero if none are in flight.
+	OldestInFlight time.Duration
 }
 
-type callType uint
+// Stats returns a snapshot of call activity broken down by CallType, useful
+// for diagnosing why a solve is slow without having to patch gps.
+func (cm *callManager) Stats() map[CallType]CallStats {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	stats := make(map[CallType]CallStats, len(cm.ran))
+	for typ, dc := range cm.ran {
+		stats[typ] = CallStats{Count: dc.count, Duration: dc.dur}
+	}
+
+	now := time.Now()
+	for ci, tc := range cm.running {
+		s := stats[ci.typ]
+		s.InFlight += tc.count
+		if age := now.Sub(tc.start); age > s.OldestInFlight {
+			s.OldestInFlight = age
+		}
+		stats[ci.typ] = s
+	}
+
+	return stats
+}
+
+// CallType categorizes the kind of work a callManager call represents, so
+// that Stats() and RegisterCallback() consumers can break activity down by
+// what's actually slow.
+type CallType uint
 
 const (
-	ctHTTPMetadata callType = iota
-	ctListVersions
-	ctGetManifestAndLock
+	CallTypeHTTPMetadata CallType = iota
+	CallTypeListVersions
+	CallTypeGetManifestAndLock
+	CallTypeVCSFetch
+	CallTypeVCSClone
+	CallTypeVCSCheckout
 )
 
 // callInfo provides metadata about an ongoing call.
 type callInfo struct {
 	name string
-	typ  callType
+	typ  CallType
 }
 
 type srcReturnChans struct {
@@ -137,32 +324,101 @@ func (rc srcReturnChans) awaitReturn() (sg *sourceGateway, err error) {
 
 type sourceCoordinator struct {
 	callMgr   *callManager
-	srcmut    sync.RWMutex // guards srcs and nameToURL maps
+	srcmut    sync.RWMutex // guards srcs, nameToURL, and closed
 	srcs      map[string]*sourceGateway
 	nameToURL map[string]string
-	psrcmut   sync.Mutex // guards protoSrcs map
+	closed    bool
+	wg        sync.WaitGroup // tracks in-flight getSourceGatewayFor goroutines
+	psrcmut   sync.Mutex     // guards protoSrcs map
 	protoSrcs map[string][]srcReturnChans
 	deducer   *deductionCoordinator
 	cachedir  string
+	cfg       SourceManagerConfig
 }
 
-func newSourceCoordinator(cm *callManager, deducer *deductionCoordinator, cachedir string) *sourceCoordinator {
+func newSourceCoordinator(cm *callManager, deducer *deductionCoordinator, cachedir string, cfg SourceManagerConfig) *sourceCoordinator {
 	return &sourceCoordinator{
 		callMgr:   cm,
 		deducer:   deducer,
 		cachedir:  cachedir,
+		cfg:       cfg,
 		srcs:      make(map[string]*sourceGateway),
 		nameToURL: make(map[string]string),
 		protoSrcs: make(map[string][]srcReturnChans),
 	}
 }
 
+// close tears down the coordinator: it's marked closed (so no new
+// getSourceGatewayFor call, and no goroutine already in flight, can register
+// a fresh sourceGateway afterward), the callManager's lifetime context is
+// canceled, and - only once every in-flight getSourceGatewayFor goroutine
+// has actually observed that and returned - every already-established
+// sourceGateway is closed in turn.
+//
+// This is the entry point SourceManager.Release() fans out to; embedders
+// that hold onto a SourceManager across many solves should call it when
+// they're done, rather than relying on process exit to reclaim goroutines,
+// VCS locks, and cache file handles.
+func (sc *sourceCoordinator) close() error {
+	sc.srcmut.Lock()
+	sc.closed = true
+	sc.srcmut.Unlock()
+
+	sc.callMgr.cancelFunc()
+
+	// Wait for every getSourceGatewayFor goroutine still resolving a
+	// proto-source to notice the cancellation (or the closed flag) and
+	// return. Each one either delivers a result to every awaitReturn
+	// waiting on its normalizedName (via doReturn, or directly if it saw
+	// the closed flag) or has folded its return chans into another
+	// goroutine's entry that will - so by the time this
+	// returns, protoSrcs is empty and no late sourceGateway can slip into
+	// sc.srcs behind the loop below.
+	sc.wg.Wait()
+
+	sc.psrcmut.Lock()
+	sc.protoSrcs = make(map[string][]srcReturnChans)
+	sc.psrcmut.Unlock()
+
+	sc.srcmut.Lock()
+	defer sc.srcmut.Unlock()
+
+	var err error
+	for _, sg := range sc.srcs {
+		if cerr := sg.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// sourceGatewayKey derives the key sc.srcs is indexed by. A resolved source
+// URL is shared by every sub-package postfix deduced against the same repo
+// root (they all live in the one on-disk clone), but each postfix needs its
+// own sourceGateway so its cache and scoped listPackages/getManifestAndLock
+// calls don't collide with a sibling postfix's.
+func sourceGatewayKey(url, postfix string) string {
+	if postfix == "" {
+		return url
+	}
+	return url + "#" + postfix
+}
+
 func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id ProjectIdentifier) (*sourceGateway, error) {
 	normalizedName := id.normalizedSource()
 
+	// nameToURL stores the sourceGatewayKey (resolved URL, optionally
+	// qualified by postfix), not the bare URL, so that normalizedNames
+	// deduced with different postfixes against the same repo root still
+	// resolve to their own sourceGateway.
 	sc.srcmut.RLock()
-	if url, has := sc.nameToURL[normalizedName]; has {
-		if srcGate, has := sc.srcs[url]; has {
+	if sc.closed {
+		sc.srcmut.RUnlock()
+		return nil, fmt.Errorf("sourceCoordinator is closed")
+	}
+	if gwKey, has := sc.nameToURL[normalizedName]; has {
+		if srcGate, has := sc.srcs[gwKey]; has {
 			sc.srcmut.RUnlock()
 			return srcGate, nil
 		}
@@ -177,8 +433,26 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 	}
 
 	// The rest of the work needs its own goroutine, the results of which will
-	// be re-joined to this call via the return chans.
+	// be re-joined to this call via the return chans. sc.wg tracks it so
+	// close() can wait for it to actually finish instead of just racing it.
+	sc.wg.Add(1)
 	go func() {
+		defer sc.wg.Done()
+
+		sc.srcmut.RLock()
+		closed := sc.closed
+		sc.srcmut.RUnlock()
+		if closed {
+			sc.psrcmut.Lock()
+			rcs := append(sc.protoSrcs[normalizedName], rc)
+			delete(sc.protoSrcs, normalizedName)
+			sc.psrcmut.Unlock()
+			for _, rc := range rcs {
+				rc.err <- fmt.Errorf("sourceCoordinator closed while resolving %q", normalizedName)
+			}
+			return
+		}
+
 		sc.psrcmut.Lock()
 		if chans, has := sc.protoSrcs[normalizedName]; has {
 			// Another goroutine is already working on this normalizedName. Fold
@@ -209,7 +483,12 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 			sc.psrcmut.Unlock()
 		}
 
-		pd, err := sc.deducer.deduceRootPath(normalizedName)
+		// pd.postfix holds whatever path segment followed the deduced repo
+		// root - e.g. normalizedName "github.com/foo/bar/subpkg" deduces
+		// root "github.com/foo/bar" with postfix "subpkg" - so that source
+		// constraints naming a sub-package can resolve against a repo whose
+		// real root is further up the tree.
+		pd, err := sc.deducer.deduceRootPath(ctx, normalizedName)
 		if err != nil {
 			// As in the deducer, don't cache errors so that externally-driven retry
 			// strategies can be constructed.
@@ -224,8 +503,8 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 		// and bailing out if we find an entry.
 		var srcGate *sourceGateway
 		sc.srcmut.RLock()
-		if url, has := sc.nameToURL[normalizedName]; has {
-			if srcGate, has := sc.srcs[url]; has {
+		if gwKey, has := sc.nameToURL[normalizedName]; has {
+			if srcGate, has := sc.srcs[gwKey]; has {
 				sc.srcmut.RUnlock()
 				doReturn(srcGate, nil)
 				return
@@ -235,7 +514,7 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 		}
 		sc.srcmut.RUnlock()
 
-		srcGate = newSourceGateway(pd.mb, sc.callMgr, sc.cachedir)
+		srcGate = newSourceGateway(pd.mb, sc.callMgr, sc.cachedir, normalizedName, pd.postfix, sc.cfg)
 
 		// The normalized name is usually different from the source URL- e.g.
 		// github.com/sdboyer/gps vs. https://github.com/sdboyer/gps. But it's
@@ -257,26 +536,52 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 		// integrate it back into the main map.
 		sc.srcmut.Lock()
 		defer sc.srcmut.Unlock()
-		// Record the name -> URL mapping, even if it's a self-mapping.
-		sc.nameToURL[normalizedName] = url
 
-		if sa, has := sc.srcs[url]; has {
-			// URL already had an entry in the main map; use that as the result.
+		if sc.closed {
+			// The coordinator was closed while we were off deducing/dialing.
+			// Don't register a gateway nobody will ever close; close the one
+			// we just built instead and report the shutdown as an error.
+			srcGate.close()
+			doReturn(nil, fmt.Errorf("sourceCoordinator closed while resolving %q", normalizedName))
+			return
+		}
+
+		gwKey := sourceGatewayKey(url, pd.postfix)
+		// Record the name -> gateway-key mapping, even if it's a self-mapping.
+		sc.nameToURL[normalizedName] = gwKey
+
+		if sa, has := sc.srcs[gwKey]; has {
+			// This (url, postfix) pair already had an entry in the main map;
+			// use that as the result, and close the redundant srcGate we
+			// just lost the race on so its cache (and any refcounted bolt.DB
+			// handle it acquired) doesn't leak. sa is still the right value
+			// to hand back even if the discarded gateway fails to close.
+			srcGate.close()
 			doReturn(sa, nil)
 			return
 		}
 
-		sc.srcs[url] = srcGate
+		sc.srcs[gwKey] = srcGate
 		doReturn(srcGate, nil)
 	}()
 
 	return rc.awaitReturn()
 }
 
+// sourceCloser is implemented by source backends that hold resources - VCS
+// repo locks, open handles - needing explicit release on shutdown. Not every
+// source backend needs one, so sourceGateway.close() treats it as optional.
+type sourceCloser interface {
+	close() error
+}
+
 // sourceGateways manage all incoming calls for data from sources, serializing
 // and caching them as needed.
 type sourceGateway struct {
 	cachedir string
+	name     string // normalized source name, used only for diagnostics
+	postfix  string // sub-package path segment after the deduced repo root, if any
+	cfg      SourceManagerConfig
 	maybe    maybeSource
 	srcState sourceState
 	src      source
@@ -286,13 +591,21 @@ type sourceGateway struct {
 	callMgr  *callManager
 }
 
-func newSourceGateway(maybe maybeSource, callMgr *callManager, cachedir string) *sourceGateway {
+func newSourceGateway(maybe maybeSource, callMgr *callManager, cachedir, name, postfix string, cfg SourceManagerConfig) *sourceGateway {
 	sg := &sourceGateway{
 		maybe:    maybe,
 		cachedir: cachedir,
+		name:     name,
+		postfix:  postfix,
+		cfg:      cfg,
 		callMgr:  callMgr,
 	}
-	sg.cache = sg.createSingleSourceCache()
+	// The persistent cache is keyed on the resolved source URL, not the
+	// (possibly-vanity, possibly-duplicated) import path sg.name was
+	// deduced from - but the URL isn't known until sourceIsSetUp succeeds.
+	// Start with a memory-only placeholder and swap to the real, URL-keyed
+	// cache once requireState resolves sg.url.
+	sg.cache = newMemoryCache()
 
 	return sg
 }
@@ -352,22 +665,24 @@ func (sg *sourceGateway) getManifestAndLock(pr ProjectRoot, v Version, an Projec
 		return nil, nil, err
 	}
 
-	pi, has := sg.cache.getProjectInfo(r, an)
+	cr := sg.cacheRevision(r)
+	pi, has := sg.cache.getProjectInfo(cr, an)
 	if has {
 		return pi.Manifest, pi.Lock, nil
 	}
 
-	m, l, err := sg.src.getManifestAndLock(pr, r, an)
+	m, l, err := sg.src.getManifestAndLock(sg.scopedProjectRoot(pr), r, an)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	sg.cache.setProjectInfo(r, an, projectInfo{Manifest: m, Lock: l})
+	sg.cache.setProjectInfo(cr, an, projectInfo{Manifest: m, Lock: l})
 	return m, l, nil
 }
 
-// FIXME ProjectRoot input either needs to parameterize the cache, or be
-// incorporated on the fly on egress...?
+// listPackages lists the packages within pr, scoped to sg.postfix when this
+// gateway was deduced from a source URL with a sub-package postfix (e.g.
+// github.com/foo/bar/subpkg deduced against repo root github.com/foo/bar).
 func (sg *sourceGateway) listPackages(pr ProjectRoot, v Version) (PackageTree, error) {
 	sg.mu.Lock()
 	defer sg.mu.Unlock()
@@ -377,20 +692,44 @@ func (sg *sourceGateway) listPackages(pr ProjectRoot, v Version) (PackageTree, e
 		return PackageTree{}, err
 	}
 
-	ptree, has := sg.cache.getPackageTree(r)
+	cr := sg.cacheRevision(r)
+	ptree, has := sg.cache.getPackageTree(cr)
 	if has {
 		return ptree, nil
 	}
 
-	ptree, err = sg.src.listPackages(pr, r)
+	ptree, err = sg.src.listPackages(sg.scopedProjectRoot(pr), r)
 	if err != nil {
 		return PackageTree{}, err
 	}
 
-	sg.cache.setPackageTree(r, ptree)
+	sg.cache.setPackageTree(cr, ptree)
 	return ptree, nil
 }
 
+// scopedProjectRoot folds sg.postfix into pr, so that a source deduced with a
+// sub-package postfix has its listPackages/getManifestAndLock calls scoped
+// to that subtree rather than the repo root.
+func (sg *sourceGateway) scopedProjectRoot(pr ProjectRoot) ProjectRoot {
+	if sg.postfix == "" {
+		return pr
+	}
+	if strings.HasSuffix(string(pr), "/"+sg.postfix) {
+		return pr
+	}
+	return ProjectRoot(path.Join(string(pr), sg.postfix))
+}
+
+// cacheRevision qualifies r with sg.postfix, if any, so that projectInfo and
+// PackageTree cache entries for different postfixes of the same underlying
+// clone don't collide with each other under the same Revision key.
+func (sg *sourceGateway) cacheRevision(r Revision) Revision {
+	if sg.postfix == "" {
+		return r
+	}
+	return Revision(string(r) + "#" + sg.postfix)
+}
+
 func (sg *sourceGateway) convertToRevision(v Version) (Revision, error) {
 	// When looking up by Version, there are four states that may have
 	// differing opinions about version->revision mappings:
@@ -431,7 +770,10 @@ func (sg *sourceGateway) convertToRevision(v Version) (Revision, error) {
 	return r, nil
 }
 
-func (sg *sourceGateway) listVersions() ([]Version, error) {
+// listVersions returns the paired versions known for this source, straight
+// from the cache, so callers (the solver, in particular) can pair-match
+// without having to reconstruct v.Is(r) on every lookup.
+func (sg *sourceGateway) listVersions() ([]PairedVersion, error) {
 	sg.mu.Lock()
 	defer sg.mu.Unlock()
 
@@ -443,7 +785,11 @@ func (sg *sourceGateway) listVersions() ([]Version, error) {
 		return nil, err
 	}
 
-	return sg.cache.getAllVersions(), nil
+	pvs, has := sg.cache.getAllVersions()
+	if !has {
+		return nil, fmt.Errorf("%s has no cached version list despite require() succeeding", sg.url)
+	}
+	return pvs, nil
 }
 
 func (sg *sourceGateway) revisionPresentIn(r Revision) (bool, error) {
@@ -475,14 +821,89 @@ func (sg *sourceGateway) sourceURL(ctx context.Context) (string, error) {
 }
 
 // createSingleSourceCache creates a singleSourceCache instance for use by
-// the encapsulated source.
+// the encapsulated source, bucketed on sg.url - the resolved source URL -
+// rather than sg.name, so that two different import paths (e.g. a vanity
+// import and the direct repo path it resolves to) which land on the same
+// repository share one on-disk bucket instead of each getting their own.
 func (sg *sourceGateway) createSingleSourceCache() singleSourceCache {
-	// TODO(sdboyer) when persistent caching is ready, just drop in the creation
-	// of a source-specific handle here
-	return newMemoryCache()
+	if sg.cfg.DisableCache {
+		return newMemoryCache()
+	}
+
+	bc, err := newBoltSingleSourceCache(sg.cachedir, sg.url)
+	if err != nil {
+		// A missing or corrupt disk cache shouldn't be fatal to
+		// constructing the gateway; just fall back to memory-only.
+		return newMemoryCache()
+	}
+	return bc
+}
+
+// swapToURLKeyedCache replaces sg.cache's memory-only placeholder (set by
+// newSourceGateway, before sg.url was known) with the real, URL-keyed
+// cache. It's called once sourceIsSetUp succeeds and sg.url is populated;
+// anything the placeholder had already accumulated is discarded, since
+// requireState never does cache-dependent work before sourceIsSetUp.
+func (sg *sourceGateway) swapToURLKeyedCache() {
+	if old := sg.cache; old != nil {
+		old.close()
+	}
+	sg.cache = sg.createSingleSourceCache()
+}
+
+// close releases the resources held by sg's cache and underlying source.
+// The gateway must not be used after close returns.
+func (sg *sourceGateway) close() error {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	var err error
+	if sg.cache != nil {
+		err = sg.cache.close()
+	}
+
+	if sc, ok := sg.src.(sourceCloser); ok {
+		if serr := sc.close(); serr != nil && err == nil {
+			err = serr
+		}
+	}
+
+	return err
 }
 
+// require satisfies the requested sourceState, fetching whatever's missing.
+//
+// If cfg.PreferLocal is set, upstream-touching states (sourceExistsUpstream,
+// sourceHasLatestVersionList) are tried against local/cached data first;
+// upstream is only consulted if that genuinely isn't enough to satisfy them.
 func (sg *sourceGateway) require(ctx context.Context, wanted sourceState) (errState sourceState, err error) {
+	if sg.cfg.PreferLocal {
+		if trim := wanted & (sourceExistsUpstream | sourceHasLatestVersionList); trim != 0 {
+			local := (wanted &^ trim) | sourceIsSetUp | sourceExistsLocally
+			if _, err := sg.requireState(ctx, local); err == nil {
+				// requireState(local) only proves the repo is cloned on
+				// disk; it says nothing about whether sg.cache actually has
+				// a version list warmed. Trimming sourceHasLatestVersionList
+				// on that basis alone would make listVersions/convertToRevision
+				// read an empty cache and wrongly conclude "no versions"
+				// instead of falling back upstream, so only trim it when the
+				// cache can actually answer getAllVersions.
+				if trim&sourceHasLatestVersionList != 0 {
+					if _, has := sg.cache.getAllVersions(); !has {
+						trim &^= sourceHasLatestVersionList
+					}
+				}
+				wanted &^= trim
+			}
+		}
+	}
+
+	return sg.requireState(ctx, wanted)
+}
+
+// requireState does the actual work of walking sg.srcState toward wanted,
+// performing whatever fetches are needed for each missing bit.
+func (sg *sourceGateway) requireState(ctx context.Context, wanted sourceState) (errState sourceState, err error) {
 	todo := (^sg.srcState) & wanted
 	var flag sourceState
 	for i := uint(0); todo != 0; i++ {
@@ -496,6 +917,9 @@ func (sg *sourceGateway) require(ctx context.Context, wanted sourceState) (errSt
 			switch flag {
 			case sourceIsSetUp:
 				sg.src, sg.url, err = sg.maybe.try(ctx, sg.cachedir, sg.cache)
+				if err == nil {
+					sg.swapToURLKeyedCache()
+				}
 			case sourceExistsUpstream:
 				// TODO(sdboyer) doing it this way kinda muddles responsibility
 				if !sg.src.checkExistence(existsUpstream) {
@@ -0,0 +1,163 @@
+package gps
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSourceGatewayKey(t *testing.T) {
+	if k := sourceGatewayKey("https://github.com/foo/bar", ""); k != "https://github.com/foo/bar" {
+		t.Errorf("got %q, want bare URL with no postfix", k)
+	}
+	if k := sourceGatewayKey("https://github.com/foo/bar", "subpkg"); k != "https://github.com/foo/bar#subpkg" {
+		t.Errorf("got %q, want URL#postfix", k)
+	}
+}
+
+func TestCallManagerSemaphoreLimitsConcurrency(t *testing.T) {
+	cm := newCallManager(context.Background(), 1)
+
+	_, done1, err := cm.setUpCall(context.Background(), "repo-a", CallTypeVCSClone)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// A second throttled call for a *different* repo should block, since
+	// maxConcurrentVCS is 1 and the semaphore is already held.
+	blocked := make(chan struct{})
+	go func() {
+		_, done2, err := cm.setUpCall(context.Background(), "repo-b", CallTypeVCSClone)
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+			close(blocked)
+			return
+		}
+		done2()
+		close(blocked)
+	}()
+
+	select {
+	case <-blocked:
+		t.Fatal("second throttled call proceeded despite the semaphore being held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	done1()
+
+	select {
+	case <-blocked:
+	case <-time.After(time.Second):
+		t.Fatal("second throttled call never proceeded after the semaphore was released")
+	}
+}
+
+func TestCallManagerRepoLockSerializesSameRepo(t *testing.T) {
+	cm := newCallManager(context.Background(), 0)
+
+	_, done1, err := cm.setUpCall(context.Background(), "repo-a", CallTypeVCSClone)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := cm.setUpCall(ctx, "repo-a", CallTypeVCSClone); err == nil {
+		t.Error("expected a timeout acquiring the per-repo lock for a repo already in use, got nil")
+	}
+
+	done1()
+}
+
+func TestCallManagerStats(t *testing.T) {
+	cm := newCallManager(context.Background(), 0)
+
+	_, done, err := cm.setUpCall(context.Background(), "repo-a", CallTypeListVersions)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	stats := cm.Stats()
+	if stats[CallTypeListVersions].InFlight != 1 {
+		t.Errorf("InFlight = %d, want 1 while the call is still running", stats[CallTypeListVersions].InFlight)
+	}
+
+	done()
+
+	stats = cm.Stats()
+	if stats[CallTypeListVersions].InFlight != 0 {
+		t.Errorf("InFlight = %d, want 0 after done()", stats[CallTypeListVersions].InFlight)
+	}
+	if stats[CallTypeListVersions].Count != 1 {
+		t.Errorf("Count = %d, want 1", stats[CallTypeListVersions].Count)
+	}
+}
+
+func TestCallManagerRegisterCallback(t *testing.T) {
+	cm := newCallManager(context.Background(), 0)
+
+	var mu sync.Mutex
+	var events []CallEventType
+	cm.RegisterCallback(func(ev CallEvent) {
+		mu.Lock()
+		events = append(events, ev.Event)
+		mu.Unlock()
+	})
+
+	_, done, err := cm.setUpCall(context.Background(), "repo-a", CallTypeListVersions)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	done()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 || events[0] != CallEventRun || events[1] != CallEventDone {
+		t.Errorf("got events %v, want [Run Done]", events)
+	}
+}
+
+// stubMaybeSource is a maybeSource whose try() always succeeds, reporting
+// url as the resolved source URL without touching the source interface
+// (which this tree doesn't define) at all.
+type stubMaybeSource struct {
+	url string
+}
+
+func (s stubMaybeSource) try(ctx context.Context, cachedir string, cache singleSourceCache) (source, string, error) {
+	return nil, s.url, nil
+}
+
+func TestNewSourceGatewayCacheSwap(t *testing.T) {
+	cm := newCallManager(context.Background(), 0)
+	cachedir := t.TempDir()
+
+	sg := newSourceGateway(stubMaybeSource{url: "https://github.com/foo/bar"}, cm, cachedir, "github.com/foo/bar", "", SourceManagerConfig{})
+
+	placeholder := sg.cache
+	if _, ok := placeholder.(*singleSourceCacheMemory); !ok {
+		t.Fatalf("expected newSourceGateway to start with a memory-only placeholder cache, got %T", placeholder)
+	}
+
+	if _, err := sg.requireState(context.Background(), sourceIsSetUp); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if sg.url != "https://github.com/foo/bar" {
+		t.Errorf("sg.url = %q, want %q", sg.url, "https://github.com/foo/bar")
+	}
+	if sg.cache == placeholder {
+		t.Error("sourceIsSetUp succeeding didn't swap in a fresh, URL-keyed cache")
+	}
+
+	bc, ok := sg.cache.(*singleSourceCacheBolt)
+	if !ok {
+		t.Fatalf("expected the swapped-in cache to be *singleSourceCacheBolt, got %T", sg.cache)
+	}
+	if string(bc.bkt) != string(sourceCacheBucket(sg.url)) {
+		t.Error("swapped-in cache isn't bucketed on sg.url")
+	}
+
+	sg.close()
+}
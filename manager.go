@@ -0,0 +1,47 @@
+package gps
+
+import (
+	"context"
+	"fmt"
+)
+
+// SourceManager is the top-level entry point for working with gps sources.
+// Constructing one wires together the callManager, deductionCoordinator,
+// and sourceCoordinator that back every solve operation; callers get to
+// those operations through the sourceCoordinator it holds rather than
+// through SourceManager itself.
+type SourceManager struct {
+	cfg      SourceManagerConfig
+	callMgr  *callManager
+	deducer  *deductionCoordinator
+	srcCoord *sourceCoordinator
+}
+
+// NewSourceManager constructs a SourceManager from cfg. Callers must call
+// Release() once they're done with it, to tear down the goroutines, VCS
+// locks, and cache file handles it transitively holds open rather than
+// relying on process exit to reclaim them.
+func NewSourceManager(cfg SourceManagerConfig) (*SourceManager, error) {
+	if cfg.Cachedir == "" {
+		return nil, fmt.Errorf("SourceManagerConfig.Cachedir must be set")
+	}
+
+	cm := newCallManager(context.Background(), cfg.MaxConcurrentVCS)
+	deducer := newDeductionCoordinator(cm)
+	srcCoord := newSourceCoordinator(cm, deducer, cfg.Cachedir, cfg)
+
+	return &SourceManager{
+		cfg:      cfg,
+		callMgr:  cm,
+		deducer:  deducer,
+		srcCoord: srcCoord,
+	}, nil
+}
+
+// Release tears down the SourceManager: it fans out to
+// sourceCoordinator.close(), which cancels any in-flight work and releases
+// every cache and VCS resource the coordinator's sourceGateways hold. The
+// SourceManager must not be used after Release returns.
+func (sm *SourceManager) Release() error {
+	return sm.srcCoord.close()
+}
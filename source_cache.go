@@ -23,20 +23,19 @@ type singleSourceCache interface {
 	getPackageTree(Revision) (PackageTree, bool)
 
 	// Store the mappings between a set of PairedVersions' surface versions
-	// their corresponding revisions.
+	// and their corresponding revisions, replacing whatever was previously
+	// stored.
 	//
-	// If flush is true, the existing list of versions will be purged before
-	// writing. Revisions will have their pairings purged, but record of the
-	// revision existing will be kept, on the assumption that revisions are
-	// immutable and permanent.
-	storeVersionMap(versionList []PairedVersion, flush bool)
+	// Revisions will have their pairings purged, but record of the revision
+	// existing will be kept, on the assumption that revisions are immutable
+	// and permanent.
+	setVersionMap(versionList []PairedVersion)
 
 	// Get the list of unpaired versions corresponding to the given revision.
 	getVersionsFor(Revision) ([]UnpairedVersion, bool)
 
 	// Gets all the version pairs currently known to the cache.
-	getAllVersions() []Version
-	//getAllVersions() []PairedVersion
+	getAllVersions() ([]PairedVersion, bool)
 
 	// Get the revision corresponding to the given unpaired version.
 	getRevisionFor(UnpairedVersion) (Revision, bool)
@@ -51,6 +50,10 @@ type singleSourceCache interface {
 	// If the input is a revision and multiple UnpairedVersions are associated
 	// with it, whatever happens to be the first is returned.
 	toUnpaired(v Version) (UnpairedVersion, bool)
+
+	// close releases any resources (file handles, db connections) held by
+	// the cache. The cache must not be used after close returns.
+	close() error
 }
 
 type singleSourceCacheMemory struct {
@@ -59,6 +62,7 @@ type singleSourceCacheMemory struct {
 	ptrees map[Revision]PackageTree
 	vMap   map[UnpairedVersion]Revision
 	rMap   map[Revision][]UnpairedVersion
+	vList  []PairedVersion // the paired versions set by the last setVersionMap call
 }
 
 func newMemoryCache() singleSourceCache {
@@ -119,20 +123,22 @@ func (c *singleSourceCacheMemory) getPackageTree(r Revision) (PackageTree, bool)
 	return ptree, has
 }
 
-func (c *singleSourceCacheMemory) storeVersionMap(versionList []PairedVersion, flush bool) {
+// setVersionMap always flushes the existing version list before writing:
+// revisions keep their entries in rMap (on the assumption that revisions are
+// immutable and permanent), but their pairings are purged and rebuilt from
+// versionList. A partial, non-flushing update was previously supported, but
+// it couldn't guarantee cache consistency against the ptrees/infos maps, so
+// replace-on-write is the only semantic offered now.
+func (c *singleSourceCacheMemory) setVersionMap(versionList []PairedVersion) {
 	c.mut.Lock()
-	if flush {
-		// TODO(sdboyer) how do we handle cache consistency here - revs that may
-		// be out of date vis-a-vis the ptrees or infos maps?
-		for r := range c.rMap {
-			c.rMap[r] = nil
-		}
-
-		c.vMap = make(map[UnpairedVersion]Revision)
+	for r := range c.rMap {
+		c.rMap[r] = nil
 	}
+	c.vMap = make(map[UnpairedVersion]Revision)
+	c.vList = make([]PairedVersion, len(versionList))
+	copy(c.vList, versionList)
 
-	for _, v := range versionList {
-		pv := v.(PairedVersion)
+	for _, pv := range versionList {
 		u, r := pv.Unpair(), pv.Underlying()
 		c.vMap[u] = r
 		c.rMap[r] = append(c.rMap[r], u)
@@ -147,14 +153,17 @@ func (c *singleSourceCacheMemory) getVersionsFor(r Revision) ([]UnpairedVersion,
 	return versionList, has
 }
 
-//func (c *singleSourceCacheMemory) getAllVersions() []PairedVersion {
-func (c *singleSourceCacheMemory) getAllVersions() []Version {
-	//vlist := make([]PairedVersion, 0, len(c.vMap))
-	vlist := make([]Version, 0, len(c.vMap))
-	for v, r := range c.vMap {
-		vlist = append(vlist, v.Is(r))
+func (c *singleSourceCacheMemory) getAllVersions() ([]PairedVersion, bool) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	if c.vList == nil {
+		return nil, false
 	}
-	return vlist
+
+	vlist := make([]PairedVersion, len(c.vList))
+	copy(vlist, c.vList)
+	return vlist, true
 }
 
 func (c *singleSourceCacheMemory) getRevisionFor(uv UnpairedVersion) (Revision, bool) {
@@ -180,6 +189,12 @@ func (c *singleSourceCacheMemory) toRevision(v Version) (Revision, bool) {
 	}
 }
 
+// close is a no-op for singleSourceCacheMemory, as it holds no resources
+// beyond the maps the garbage collector already handles.
+func (c *singleSourceCacheMemory) close() error {
+	return nil
+}
+
 func (c *singleSourceCacheMemory) toUnpaired(v Version) (UnpairedVersion, bool) {
 	switch t := v.(type) {
 	case UnpairedVersion:
@@ -0,0 +1,443 @@
+package gps
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/boltdb/bolt"
+)
+
+// cacheSchemaVersion is written into every bucket singleSourceCacheBolt
+// manages. If it's ever bumped, entries written under the old version are
+// dropped rather than decoded, as the simplest way to handle incompatible
+// on-disk encodings across gps versions.
+const cacheSchemaVersion byte = 1
+
+var (
+	cacheBucketInfo    = []byte("info")
+	cacheBucketPtree   = []byte("ptree")
+	cacheBucketVersion = []byte("version")
+	cacheKeySchema     = []byte("schema")
+	cacheKeyVersions   = []byte("versions")
+)
+
+// init registers every concrete Version type gob needs to know about to
+// encode/decode the interface-typed fields in cachedVersionPair and
+// cacheLock.Projects. It's necessarily incomplete: cachedProjectInfo.Deps/
+// TestDeps carry ProjectConstraints, whose Constraint values can be other
+// concrete types entirely, but the concrete Constraint implementations
+// live in source files outside this package snapshot, so there's nothing
+// to register them with yet. setProjectInfo logs rather than silently
+// dropping the write when that gap bites.
+func init() {
+	gob.Register(Revision(""))
+	gob.Register(branchVersion{})
+	gob.Register(semVersion{})
+	gob.Register(versionPair{})
+	gob.Register(plainVersion(""))
+}
+
+// singleSourceCacheBolt is a singleSourceCache that persists project infos,
+// package trees, and version lists to a BoltDB file under cachedir, so that
+// they survive process restarts instead of having to be re-warmed from
+// upstream on every cold start.
+//
+// Many sources share one underlying bolt.DB handle (opening a bolt file is
+// not cheap, and bolt only allows one process to hold a given file open at
+// a time); each source gets its own top-level bucket, named with a stable
+// hash of its resolved source URL so that unrelated sources never collide.
+type singleSourceCacheBolt struct {
+	mu   sync.RWMutex
+	db   *bolt.DB
+	bkt  []byte
+	path string // cache.db path this instance's handle was acquired under
+}
+
+func boltCachePath(cachedir string) string {
+	return filepath.Join(cachedir, "cache.db")
+}
+
+// boltDBs tracks the shared, ref-counted bolt.DB handles backing
+// singleSourceCacheBolt instances. Every source within a cachedir shares one
+// underlying file (and therefore one *bolt.DB), since bolt only allows a
+// single process to hold a file open at a time; the refcount ensures the
+// handle stays open as long as any source is still using it, and is closed
+// once the last one releases it.
+var (
+	boltDBsMu sync.Mutex
+	boltDBs   = make(map[string]*refCountedBoltDB)
+)
+
+type refCountedBoltDB struct {
+	db   *bolt.DB
+	refs int
+}
+
+func acquireBoltDB(path string) (*bolt.DB, error) {
+	boltDBsMu.Lock()
+	defer boltDBsMu.Unlock()
+
+	if rc, has := boltDBs[path]; has {
+		rc.refs++
+		return rc.db, nil
+	}
+
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not open source cache: %s", err)
+	}
+
+	boltDBs[path] = &refCountedBoltDB{db: db, refs: 1}
+	return db, nil
+}
+
+func releaseBoltDB(path string) error {
+	boltDBsMu.Lock()
+	defer boltDBsMu.Unlock()
+
+	rc, has := boltDBs[path]
+	if !has {
+		return nil
+	}
+
+	rc.refs--
+	if rc.refs > 0 {
+		return nil
+	}
+
+	delete(boltDBs, path)
+	return rc.db.Close()
+}
+
+// sourceCacheBucket derives a stable, filesystem- and bolt-key-safe bucket
+// name for a source from its resolved URL.
+func sourceCacheBucket(srcURL string) []byte {
+	sum := sha256.Sum256([]byte(srcURL))
+	return []byte(fmt.Sprintf("%x", sum[:16]))
+}
+
+// newBoltSingleSourceCache opens (creating if necessary) the shared cache.db
+// in cachedir, and returns a singleSourceCache scoped to srcURL's bucket
+// within it.
+func newBoltSingleSourceCache(cachedir, srcURL string) (singleSourceCache, error) {
+	if err := os.MkdirAll(cachedir, 0777); err != nil {
+		return nil, err
+	}
+
+	path := boltCachePath(cachedir)
+	db, err := acquireBoltDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bkt := sourceCacheBucket(srcURL)
+	err = db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(bkt)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range [][]byte{cacheBucketInfo, cacheBucketPtree, cacheBucketVersion} {
+			sub, err := root.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+
+			if schema := sub.Get(cacheKeySchema); schema == nil {
+				if err := sub.Put(cacheKeySchema, []byte{cacheSchemaVersion}); err != nil {
+					return err
+				}
+			} else if schema[0] != cacheSchemaVersion {
+				// Schema changed out from under us - drop the stale bucket
+				// wholesale rather than risk decoding garbage.
+				if err := root.DeleteBucket(name); err != nil {
+					return err
+				}
+				sub, err = root.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				if err := sub.Put(cacheKeySchema, []byte{cacheSchemaVersion}); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		releaseBoltDB(path)
+		return nil, err
+	}
+
+	return &singleSourceCacheBolt{db: db, bkt: bkt, path: path}, nil
+}
+
+// close releases this instance's reference on the shared bolt.DB handle,
+// closing the underlying file once the last source using it has done the
+// same.
+func (c *singleSourceCacheBolt) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.path == "" {
+		return nil
+	}
+
+	err := releaseBoltDB(c.path)
+	c.path = ""
+	return err
+}
+
+func projectInfoKey(r Revision, an ProjectAnalyzer) []byte {
+	info := an.Info()
+	return []byte(fmt.Sprintf("%s.%d\x00%s", info.Name, info.Version, r))
+}
+
+type cachedProjectInfo struct {
+	Deps     ProjectConstraints
+	TestDeps ProjectConstraints
+	Lock     cacheLock
+}
+
+type cacheLock struct {
+	Hash     []byte
+	Projects []LockedProject
+}
+
+func (cl cacheLock) InputHash() []byte         { return cl.Hash }
+func (cl cacheLock) Projects() []LockedProject { return cl.Projects }
+
+type cacheManifest struct {
+	deps, testDeps ProjectConstraints
+}
+
+func (cm cacheManifest) DependencyConstraints() ProjectConstraints     { return cm.deps }
+func (cm cacheManifest) TestDependencyConstraints() ProjectConstraints { return cm.testDeps }
+
+func (c *singleSourceCacheBolt) setProjectInfo(r Revision, an ProjectAnalyzer, pi projectInfo) {
+	cpi := cachedProjectInfo{
+		Deps:     pi.Manifest.DependencyConstraints(),
+		TestDeps: pi.Manifest.TestDependencyConstraints(),
+		Lock: cacheLock{
+			Hash:     pi.Lock.InputHash(),
+			Projects: pi.Lock.Projects(),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cpi); err != nil {
+		log.Printf("gps: failed to encode project info for %q into cache: %s", r, err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(c.bkt).Bucket(cacheBucketInfo).Put(projectInfoKey(r, an), buf.Bytes())
+	}); err != nil {
+		log.Printf("gps: failed to write project info for %q to cache: %s", r, err)
+	}
+}
+
+func (c *singleSourceCacheBolt) getProjectInfo(r Revision, an ProjectAnalyzer) (projectInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var raw []byte
+	c.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(c.bkt).Bucket(cacheBucketInfo).Get(projectInfoKey(r, an)); v != nil {
+			raw = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if raw == nil {
+		return projectInfo{}, false
+	}
+
+	var cpi cachedProjectInfo
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&cpi); err != nil {
+		log.Printf("gps: failed to decode cached project info for %q: %s", r, err)
+		return projectInfo{}, false
+	}
+
+	return projectInfo{
+		Manifest: cacheManifest{deps: cpi.Deps, testDeps: cpi.TestDeps},
+		Lock:     cpi.Lock,
+	}, true
+}
+
+func (c *singleSourceCacheBolt) setPackageTree(r Revision, ptree PackageTree) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(ptree); err != nil {
+		log.Printf("gps: failed to encode package tree for %q into cache: %s", r, err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(c.bkt).Bucket(cacheBucketPtree).Put([]byte(r), buf.Bytes())
+	}); err != nil {
+		log.Printf("gps: failed to write package tree for %q to cache: %s", r, err)
+	}
+}
+
+func (c *singleSourceCacheBolt) getPackageTree(r Revision) (PackageTree, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var raw []byte
+	c.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(c.bkt).Bucket(cacheBucketPtree).Get([]byte(r)); v != nil {
+			raw = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if raw == nil {
+		return PackageTree{}, false
+	}
+
+	var ptree PackageTree
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&ptree); err != nil {
+		log.Printf("gps: failed to decode cached package tree for %q: %s", r, err)
+		return PackageTree{}, false
+	}
+	return ptree, true
+}
+
+type cachedVersionPair struct {
+	Unpaired UnpairedVersion
+	Revision Revision
+}
+
+// setVersionMap always replaces whatever version list was previously
+// persisted; see singleSourceCacheMemory.setVersionMap for why a partial
+// update isn't offered.
+//
+// Only the version pairs themselves are stored: unlike
+// singleSourceCacheMemory, no separate record of known revisions is kept.
+// After a replace, getVersionsFor reports a revision as unknown once it no
+// longer appears in versionList, and revisions seen only through
+// setProjectInfo or setPackageTree are never recorded.
+func (c *singleSourceCacheBolt) setVersionMap(versionList []PairedVersion) {
+	pairs := make([]cachedVersionPair, 0, len(versionList))
+	for _, v := range versionList {
+		pairs = append(pairs, cachedVersionPair{Unpaired: v.Unpair(), Revision: v.Underlying()})
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(pairs); err != nil {
+		log.Printf("gps: failed to encode version list into cache: %s", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(c.bkt).Bucket(cacheBucketVersion).Put(cacheKeyVersions, buf.Bytes())
+	}); err != nil {
+		log.Printf("gps: failed to write version list to cache: %s", err)
+	}
+}
+
+func (c *singleSourceCacheBolt) allPairs() ([]cachedVersionPair, bool) {
+	var raw []byte
+	c.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(c.bkt).Bucket(cacheBucketVersion).Get(cacheKeyVersions); v != nil {
+			raw = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if raw == nil {
+		return nil, false
+	}
+
+	var pairs []cachedVersionPair
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&pairs); err != nil {
+		log.Printf("gps: failed to decode cached version list: %s", err)
+		return nil, false
+	}
+	return pairs, true
+}
+
+func (c *singleSourceCacheBolt) getVersionsFor(r Revision) ([]UnpairedVersion, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pairs, _ := c.allPairs()
+	var uvs []UnpairedVersion
+	has := false
+	for _, p := range pairs {
+		if p.Revision == r {
+			has = true
+			uvs = append(uvs, p.Unpaired)
+		}
+	}
+	return uvs, has
+}
+
+func (c *singleSourceCacheBolt) getAllVersions() ([]PairedVersion, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pairs, has := c.allPairs()
+	if !has {
+		return nil, false
+	}
+
+	vlist := make([]PairedVersion, 0, len(pairs))
+	for _, p := range pairs {
+		vlist = append(vlist, p.Unpaired.Is(p.Revision).(PairedVersion))
+	}
+	return vlist, true
+}
+
+func (c *singleSourceCacheBolt) getRevisionFor(uv UnpairedVersion) (Revision, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pairs, _ := c.allPairs()
+	for _, p := range pairs {
+		if p.Unpaired == uv {
+			return p.Revision, true
+		}
+	}
+	return "", false
+}
+
+func (c *singleSourceCacheBolt) toRevision(v Version) (Revision, bool) {
+	switch t := v.(type) {
+	case Revision:
+		return t, true
+	case PairedVersion:
+		return t.Underlying(), true
+	case UnpairedVersion:
+		return c.getRevisionFor(t)
+	default:
+		panic(fmt.Sprintf("Unknown version type %T", v))
+	}
+}
+
+func (c *singleSourceCacheBolt) toUnpaired(v Version) (UnpairedVersion, bool) {
+	switch t := v.(type) {
+	case UnpairedVersion:
+		return t, true
+	case PairedVersion:
+		return t.Unpair(), true
+	case Revision:
+		uvs, has := c.getVersionsFor(t)
+		if has && len(uvs) > 0 {
+			return uvs[0], true
+		}
+		return nil, false
+	default:
+		panic(fmt.Sprintf("unknown version type %T", v))
+	}
+}
@@ -0,0 +1,121 @@
+package gps
+
+import (
+	"testing"
+)
+
+func TestSourceCacheBucketStable(t *testing.T) {
+	a1 := sourceCacheBucket("https://github.com/foo/bar")
+	a2 := sourceCacheBucket("https://github.com/foo/bar")
+	if string(a1) != string(a2) {
+		t.Errorf("sourceCacheBucket not stable across calls: %x != %x", a1, a2)
+	}
+
+	b := sourceCacheBucket("https://github.com/foo/baz")
+	if string(a1) == string(b) {
+		t.Errorf("sourceCacheBucket produced the same bucket for two different URLs: %x", a1)
+	}
+}
+
+func TestNewBoltSingleSourceCacheSharesURL(t *testing.T) {
+	dir := t.TempDir()
+
+	// Two gateways resolving to the same URL - e.g. a vanity import and
+	// the direct path it resolves to - must land in the same bucket of
+	// the same on-disk file, not get one each.
+	c1, err := newBoltSingleSourceCache(dir, "https://github.com/foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c1.close()
+
+	c2, err := newBoltSingleSourceCache(dir, "https://github.com/foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c2.close()
+
+	bc1, ok1 := c1.(*singleSourceCacheBolt)
+	bc2, ok2 := c2.(*singleSourceCacheBolt)
+	if !ok1 || !ok2 {
+		t.Fatalf("expected *singleSourceCacheBolt, got %T and %T", c1, c2)
+	}
+
+	if bc1.path != bc2.path {
+		t.Errorf("two caches under the same cachedir got different cache.db paths: %q != %q", bc1.path, bc2.path)
+	}
+	if string(bc1.bkt) != string(bc2.bkt) {
+		t.Errorf("two caches for the same URL got different buckets: %x != %x", bc1.bkt, bc2.bkt)
+	}
+	if bc1.db != bc2.db {
+		t.Error("two caches under the same cachedir didn't share the same *bolt.DB handle")
+	}
+}
+
+func TestNewBoltSingleSourceCacheDistinctURLs(t *testing.T) {
+	dir := t.TempDir()
+
+	c1, err := newBoltSingleSourceCache(dir, "https://github.com/foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c1.close()
+
+	c2, err := newBoltSingleSourceCache(dir, "https://github.com/foo/baz")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c2.close()
+
+	bc1 := c1.(*singleSourceCacheBolt)
+	bc2 := c2.(*singleSourceCacheBolt)
+
+	if string(bc1.bkt) == string(bc2.bkt) {
+		t.Errorf("two caches for different URLs got the same bucket: %x", bc1.bkt)
+	}
+}
+
+func TestBoltDBRefcounting(t *testing.T) {
+	dir := t.TempDir()
+	path := boltCachePath(dir)
+
+	db1, err := acquireBoltDB(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	db2, err := acquireBoltDB(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if db1 != db2 {
+		t.Fatal("acquireBoltDB returned different handles for the same path")
+	}
+
+	boltDBsMu.Lock()
+	refs := boltDBs[path].refs
+	boltDBsMu.Unlock()
+	if refs != 2 {
+		t.Errorf("refs = %d, want 2", refs)
+	}
+
+	if err := releaseBoltDB(path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	boltDBsMu.Lock()
+	_, stillOpen := boltDBs[path]
+	boltDBsMu.Unlock()
+	if !stillOpen {
+		t.Fatal("releaseBoltDB closed the handle while a second reference was still outstanding")
+	}
+
+	if err := releaseBoltDB(path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	boltDBsMu.Lock()
+	_, stillOpen = boltDBs[path]
+	boltDBsMu.Unlock()
+	if stillOpen {
+		t.Fatal("releaseBoltDB left the handle registered after the last reference was released")
+	}
+}